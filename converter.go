@@ -0,0 +1,119 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"reflect"
+	"sync"
+)
+
+// TypeConverter converts values of SrcType to DstType when marshaling a
+// struct field to a SQL value, or unmarshaling a SQL value back into a
+// struct field. SrcType and DstType can be either a reflect.Type or a value
+// of the type to describe; in the latter case, its type is used.
+//
+// For example, to store a time.Time as a Unix timestamp:
+//
+//	s.WithConverters(sqlbuilder.TypeConverter{
+//	    SrcType: time.Time{},
+//	    DstType: int64(0),
+//	    Fn: func(src interface{}) (interface{}, error) {
+//	        return src.(time.Time).Unix(), nil
+//	    },
+//	})
+type TypeConverter struct {
+	SrcType interface{}
+	DstType interface{}
+	Fn      func(src interface{}) (interface{}, error)
+}
+
+type converterKey struct {
+	src reflect.Type
+	dst reflect.Type
+}
+
+// typeOf returns the reflect.Type described by v, which is either a
+// reflect.Type already or a sample value of the type.
+func typeOf(v interface{}) reflect.Type {
+	if t, ok := v.(reflect.Type); ok {
+		return t
+	}
+
+	return reflect.TypeOf(v)
+}
+
+// WithConverters returns a new Struct based on s with additional type
+// converters registered. Converters registered for a (SrcType, DstType) pair
+// that already exists in s replace the existing one; among converters that
+// share only a SrcType (used to pick a write-side converter, since the
+// SQL-facing DstType isn't known until the driver sees it), the last one
+// registered wins. The original s is not changed.
+func (s *Struct) WithConverters(converters ...TypeConverter) *Struct {
+	if s.structType == nil {
+		return &emptyStruct
+	}
+
+	c := *s
+	c.converters = make(map[converterKey]TypeConverter, len(s.converters)+len(converters))
+	c.convertersBySrc = make(map[reflect.Type]TypeConverter, len(s.convertersBySrc)+len(converters))
+
+	for k, v := range s.converters {
+		c.converters[k] = v
+	}
+
+	for k, v := range s.convertersBySrc {
+		c.convertersBySrc[k] = v
+	}
+
+	for _, conv := range converters {
+		src := typeOf(conv.SrcType)
+		key := converterKey{src: src, dst: typeOf(conv.DstType)}
+		c.converters[key] = conv
+		c.convertersBySrc[src] = conv
+	}
+
+	c.scanPlanCache = &sync.Map{}
+	return &c
+}
+
+// hasConverterForDst reports whether any converter, regardless of its
+// source type, targets dstType. It's used to decide, before a driver value
+// has been scanned (and so before its concrete type is known), whether a
+// field needs to be scanned indirectly so it can go through convertForRead.
+func (s *Struct) hasConverterForDst(dstType reflect.Type) bool {
+	for key := range s.converters {
+		if key.dst == dstType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// convertForWrite converts val through the converter registered for val's
+// type, if any, before it's handed to the SQL builder. If no converter
+// matches, val is returned unchanged.
+func (s *Struct) convertForWrite(val reflect.Value) (interface{}, error) {
+	data := val.Interface()
+
+	if conv, ok := s.convertersBySrc[val.Type()]; ok {
+		return conv.Fn(data)
+	}
+
+	return data, nil
+}
+
+// convertForRead converts a value scanned from the driver into dstType
+// through the converter registered for the exact (src, dst) pair, where src
+// is data's own type, if one is registered. If no converter matches, data
+// is returned unchanged.
+func (s *Struct) convertForRead(data interface{}, dstType reflect.Type) (interface{}, error) {
+	key := converterKey{src: reflect.TypeOf(data), dst: dstType}
+
+	if conv, ok := s.converters[key]; ok {
+		return conv.Fn(data)
+	}
+
+	return data, nil
+}
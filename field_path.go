@@ -0,0 +1,259 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by Struct#FieldByTag and Struct#SetByPath. Use errors.Is
+// to test for them, since they're always wrapped with context: the path for
+// SetByPath, the struct type (and tag) for FieldByTag.
+var (
+	ErrFieldNotFound   = errors.New("sqlbuilder: field not found")
+	ErrFieldUnexported = errors.New("sqlbuilder: field is unexported")
+	ErrTypeMismatch    = errors.New("sqlbuilder: value type mismatch")
+)
+
+// bracketSplitter splits a path segment like `Tags[0]` or `Meta["k"]` into
+// its field name and the (possibly empty) sequence of bracketed indices.
+var bracketSplitter = regexp.MustCompile(`^(\w+)((?:\[[^\[\]]*\])*)$`)
+var indexMatcher = regexp.MustCompile(`\[([^\[\]]*)\]`)
+
+// FieldByTag returns the value of the first field in st, a struct or a
+// pointer to one, whose tagKey tag is exactly tagValue.
+//
+// Unlike the rest of Struct's API, FieldByTag doesn't use s's own type: it
+// inspects st directly, so it can be used to look up a column on any
+// row-struct without first building a Struct for it.
+func (s *Struct) FieldByTag(st interface{}, tagKey, tagValue string) (interface{}, error) {
+	v := dereferencedValue(reflect.ValueOf(st))
+
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sqlbuilder: %T is not a struct: %w", st, ErrTypeMismatch)
+	}
+
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if val, ok := f.Tag.Lookup(tagKey); ok && val == tagValue {
+			return v.Field(i).Interface(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("sqlbuilder: no field with tag %s=%q in %v: %w", tagKey, tagValue, t, ErrFieldNotFound)
+}
+
+// SetByPath sets the field of st, a pointer to a struct, named by a dotted
+// path such as "Billing.Address.Zip", to value. Path segments may include
+// slice/map indices, e.g. "Tags[0]" or `Meta["k"]`.
+func (s *Struct) SetByPath(st interface{}, path string, value interface{}) error {
+	rv := reflect.ValueOf(st)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("sqlbuilder: SetByPath requires a non-nil pointer, got %T", st)
+	}
+
+	segments := strings.Split(path, ".")
+	cur := rv.Elem()
+
+	for i, seg := range segments {
+		name, indices, err := parsePathSegment(seg)
+
+		if err != nil {
+			return fmt.Errorf("sqlbuilder: %q: %w", path, err)
+		}
+
+		cur = dereferencedValue(cur)
+
+		if cur.Kind() != reflect.Struct {
+			return fmt.Errorf("sqlbuilder: %q: %w", path, ErrTypeMismatch)
+		}
+
+		sf, ok := cur.Type().FieldByName(name)
+
+		if !ok {
+			return fmt.Errorf("sqlbuilder: %q: %w", path, ErrFieldNotFound)
+		}
+
+		if sf.PkgPath != "" {
+			return fmt.Errorf("sqlbuilder: %q: %w", path, ErrFieldUnexported)
+		}
+
+		cur = cur.FieldByIndex(sf.Index)
+		last := i == len(segments)-1
+
+		for j, idx := range indices {
+			lastIdx := last && j == len(indices)-1
+
+			if done, err := setByIndex(&cur, idx, lastIdx, value, path); err != nil {
+				return err
+			} else if done {
+				return nil
+			}
+		}
+
+		if last && len(indices) == 0 {
+			return setReflectValue(cur, value, path)
+		}
+	}
+
+	return nil
+}
+
+// setByIndex descends cur by a single `[idx]` path index. If this is the
+// final index of the final path segment, the indexed element is set to
+// value and done is true.
+func setByIndex(cur *reflect.Value, idx string, lastIdx bool, value interface{}, path string) (done bool, err error) {
+	*cur = dereferencedValue(*cur)
+
+	switch cur.Kind() {
+	case reflect.Slice, reflect.Array:
+		n, convErr := strconv.Atoi(idx)
+
+		if convErr != nil || n < 0 || n >= cur.Len() {
+			return false, fmt.Errorf("sqlbuilder: %q: %w", path, ErrFieldNotFound)
+		}
+
+		elem := cur.Index(n)
+
+		if lastIdx {
+			return true, setReflectValue(elem, value, path)
+		}
+
+		*cur = elem
+		return false, nil
+
+	case reflect.Map:
+		key, convErr := convertMapKey(cur.Type().Key(), idx)
+
+		if convErr != nil {
+			return false, fmt.Errorf("sqlbuilder: %q: %w", path, ErrTypeMismatch)
+		}
+
+		if cur.IsNil() {
+			return false, fmt.Errorf("sqlbuilder: %q: %w", path, ErrFieldNotFound)
+		}
+
+		if lastIdx {
+			val, err := valueForAssign(value, cur.Type().Elem())
+
+			if err != nil {
+				return true, fmt.Errorf("sqlbuilder: %q: %w", path, err)
+			}
+
+			cur.SetMapIndex(key, val)
+			return true, nil
+		}
+
+		elem := cur.MapIndex(key)
+
+		if !elem.IsValid() {
+			return false, fmt.Errorf("sqlbuilder: %q: %w", path, ErrFieldNotFound)
+		}
+
+		*cur = elem
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("sqlbuilder: %q: %w", path, ErrTypeMismatch)
+	}
+}
+
+// setReflectValue assigns value to dst, the final destination of a path.
+func setReflectValue(dst reflect.Value, value interface{}, path string) error {
+	if !dst.CanSet() {
+		return fmt.Errorf("sqlbuilder: %q: %w", path, ErrFieldUnexported)
+	}
+
+	val, err := valueForAssign(value, dst.Type())
+
+	if err != nil {
+		return fmt.Errorf("sqlbuilder: %q: %w", path, err)
+	}
+
+	dst.Set(val)
+	return nil
+}
+
+// valueForAssign returns the reflect.Value to assign into a field or map
+// element of type t for value. A nil value is treated as t's zero value
+// when t's kind can hold nil (pointer, slice, map, interface, chan, func),
+// since clearing a field to nil is an ordinary part of building partial
+// updates via SetByPath; reflect.ValueOf(nil) is the invalid zero Value and
+// calling Type() on it panics, so nil must be special-cased before that
+// point rather than passed through. It returns ErrTypeMismatch if value is
+// nil but t can't hold nil, or if value's type isn't assignable to t.
+func valueForAssign(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Chan, reflect.Func:
+			return reflect.Zero(t), nil
+		default:
+			return reflect.Value{}, ErrTypeMismatch
+		}
+	}
+
+	val := reflect.ValueOf(value)
+
+	if !val.Type().AssignableTo(t) {
+		return reflect.Value{}, ErrTypeMismatch
+	}
+
+	return val, nil
+}
+
+// convertMapKey converts the bracketed index token raw (e.g. `"k"` or `3`)
+// into a reflect.Value usable as a map key of keyType.
+func convertMapKey(keyType reflect.Type, raw string) (reflect.Value, error) {
+	switch keyType.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(strings.Trim(raw, `"'`)).Convert(keyType), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		v := reflect.New(keyType).Elem()
+		v.SetInt(n)
+		return v, nil
+
+	default:
+		return reflect.Value{}, fmt.Errorf("sqlbuilder: unsupported map key type %v", keyType)
+	}
+}
+
+// parsePathSegment splits seg, e.g. `Tags[0]`, into its field name and the
+// sequence of bracketed indices, in order.
+func parsePathSegment(seg string) (name string, indices []string, err error) {
+	m := bracketSplitter.FindStringSubmatch(seg)
+
+	if m == nil {
+		return "", nil, fmt.Errorf("malformed path segment %q", seg)
+	}
+
+	name = m[1]
+
+	if m[2] != "" {
+		for _, idxMatch := range indexMatcher.FindAllStringSubmatch(m[2], -1) {
+			indices = append(indices, idxMatch[1])
+		}
+	}
+
+	return name, indices, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"errors"
+	"testing"
+)
+
+type fieldPathAddress struct {
+	Zip string
+}
+
+type fieldPathBilling struct {
+	Address fieldPathAddress
+}
+
+type fieldPathProfile struct {
+	Nickname *string
+	Tags     []string
+	Meta     map[string]string
+	Scores   map[string]*int
+	Billing  fieldPathBilling
+}
+
+func TestSetByPathNestedField(t *testing.T) {
+	s := NewStruct(fieldPathProfile{})
+	p := &fieldPathProfile{}
+
+	if err := s.SetByPath(p, "Billing.Address.Zip", "94107"); err != nil {
+		t.Fatalf("SetByPath returned error: %v", err)
+	}
+
+	if p.Billing.Address.Zip != "94107" {
+		t.Fatalf("Zip = %q, want %q", p.Billing.Address.Zip, "94107")
+	}
+}
+
+func TestSetByPathSliceAndMapIndex(t *testing.T) {
+	s := NewStruct(fieldPathProfile{})
+	p := &fieldPathProfile{Tags: []string{"a", "b"}, Meta: map[string]string{"k": "v"}}
+
+	if err := s.SetByPath(p, "Tags[1]", "c"); err != nil {
+		t.Fatalf("SetByPath(Tags[1]) returned error: %v", err)
+	}
+
+	if p.Tags[1] != "c" {
+		t.Fatalf(`Tags[1] = %q, want "c"`, p.Tags[1])
+	}
+
+	if err := s.SetByPath(p, `Meta["k"]`, "v2"); err != nil {
+		t.Fatalf(`SetByPath(Meta["k"]) returned error: %v`, err)
+	}
+
+	if p.Meta["k"] != "v2" {
+		t.Fatalf(`Meta["k"] = %q, want "v2"`, p.Meta["k"])
+	}
+}
+
+// TestSetByPathNilClearsNilableField reproduces the partial-update scenario
+// from the request: clearing a pointer field by setting it to nil must
+// succeed, not panic.
+func TestSetByPathNilClearsNilableField(t *testing.T) {
+	s := NewStruct(fieldPathProfile{})
+	name := "alice"
+	p := &fieldPathProfile{Nickname: &name}
+
+	if err := s.SetByPath(p, "Nickname", nil); err != nil {
+		t.Fatalf("SetByPath(nil) returned error: %v", err)
+	}
+
+	if p.Nickname != nil {
+		t.Fatalf("Nickname = %v, want nil", p.Nickname)
+	}
+}
+
+func TestSetByPathNilClearsMapValue(t *testing.T) {
+	s := NewStruct(fieldPathProfile{})
+	n := 3
+	p := &fieldPathProfile{Scores: map[string]*int{"a": &n}}
+
+	if err := s.SetByPath(p, `Scores["a"]`, nil); err != nil {
+		t.Fatalf("SetByPath(nil) returned error: %v", err)
+	}
+
+	if p.Scores["a"] != nil {
+		t.Fatalf(`Scores["a"] = %v, want nil`, p.Scores["a"])
+	}
+}
+
+// TestSetByPathNilOnNonNilableFieldFails makes sure nil is only treated as a
+// zero value when the destination's type can actually hold nil; a nil value
+// targeting a string field must still be reported as a type mismatch
+// instead of panicking or silently zeroing the field.
+func TestSetByPathNilOnNonNilableFieldFails(t *testing.T) {
+	s := NewStruct(fieldPathProfile{})
+	p := &fieldPathProfile{Billing: fieldPathBilling{Address: fieldPathAddress{Zip: "94107"}}}
+
+	err := s.SetByPath(p, "Billing.Address.Zip", nil)
+
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("err = %v, want ErrTypeMismatch", err)
+	}
+
+	if p.Billing.Address.Zip != "94107" {
+		t.Fatalf("Zip was modified despite the error: %q", p.Billing.Address.Zip)
+	}
+}
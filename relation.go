@@ -0,0 +1,179 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// RelationTag is the struct tag used to mark a field as a foreign relation
+// resolved via JOIN, e.g. `relation:"user_id=users.id,type=left"`, rather
+// than as a plain column.
+var RelationTag = "relation"
+
+// structRegistry maps a struct type to the *Struct built for it by
+// NewStruct, so that a relation field can resolve the Struct of its related
+// type without the caller having to register it explicitly.
+var structRegistry sync.Map // map[reflect.Type]*Struct
+
+// relatedStruct returns the *Struct registered for t, building and
+// registering a default one (as NewStruct would) on first use.
+func relatedStruct(t reflect.Type) *Struct {
+	if v, ok := structRegistry.Load(t); ok {
+		return v.(*Struct)
+	}
+
+	s := &Struct{
+		Flavor:             DefaultFlavor,
+		structType:         t,
+		structFieldsParser: makeDefaultFieldsParser(t),
+		scanPlanCache:      &sync.Map{},
+	}
+
+	actual, _ := structRegistry.LoadOrStore(t, s)
+	return actual.(*Struct)
+}
+
+// relationField describes a field whose type is itself a registered Struct,
+// joined in via a `relation` tag instead of being selected as a column.
+type relationField struct {
+	Index    []int
+	Name     string
+	Prefix   string // column prefix used to alias the related struct's columns
+	LocalCol string
+	Table    string
+	RelCol   string
+	JoinType JoinOption
+	Related  *Struct
+}
+
+// parseRelationTag parses the `relation:"localCol=table.col,type=jointype"`
+// tag on f, if any. It returns false if f has no relation tag, the tag is
+// malformed, or f's type is not a struct.
+func parseRelationTag(f reflect.StructField) (*relationField, bool) {
+	tag, ok := f.Tag.Lookup(RelationTag)
+
+	if !ok || tag == "" {
+		return nil, false
+	}
+
+	ft := dereferencedType(f.Type)
+
+	if ft.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	parts := strings.Split(tag, ",")
+	eq := strings.SplitN(strings.TrimSpace(parts[0]), "=", 2)
+
+	if len(eq) != 2 {
+		return nil, false
+	}
+
+	relTable, relCol := splitTableCol(eq[1])
+
+	if relTable == "" || relCol == "" {
+		return nil, false
+	}
+
+	rf := &relationField{
+		Name:     f.Name,
+		LocalCol: lastSegment(eq[0]),
+		Table:    relTable,
+		RelCol:   relCol,
+		JoinType: LeftJoin,
+		Related:  relatedStruct(ft),
+		Prefix:   strings.ToLower(f.Name) + "__",
+	}
+
+	for _, opt := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(opt), "=", 2)
+
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) != "type" {
+			continue
+		}
+
+		switch strings.TrimSpace(kv[1]) {
+		case "inner":
+			rf.JoinType = InnerJoin
+		case "right":
+			rf.JoinType = RightJoin
+		case "full":
+			rf.JoinType = FullJoin
+		default:
+			rf.JoinType = LeftJoin
+		}
+	}
+
+	return rf, true
+}
+
+// lastSegment returns the part of s after the last ".", or s itself if s
+// has no ".".
+func lastSegment(s string) string {
+	s = strings.TrimSpace(s)
+
+	if i := strings.LastIndex(s, "."); i >= 0 {
+		return s[i+1:]
+	}
+
+	return s
+}
+
+// splitTableCol splits "table.col" into its table and col parts.
+func splitTableCol(s string) (table, col string) {
+	s = strings.TrimSpace(s)
+	i := strings.LastIndex(s, ".")
+
+	if i < 0 {
+		return "", s
+	}
+
+	return s[:i], s[i+1:]
+}
+
+// columnIndex returns, for every column visible under s's default tag
+// (including those of related structs, flattened and prefixed), the field
+// index chain used to reach it from s's struct root.
+func (s *Struct) columnIndex() map[string][]int {
+	return s.columnIndexSeen(map[reflect.Type]bool{s.structType: true})
+}
+
+// columnIndexSeen is columnIndex with the set of struct types already on the
+// current relation chain, so a relation cycle (self-referencing or mutual)
+// stops recursing instead of overflowing the stack.
+func (s *Struct) columnIndexSeen(seen map[reflect.Type]bool) map[string][]int {
+	sfs := s.structFieldsParser()
+	tagged := sfs.Tag(s.structTag)
+	index := make(map[string][]int)
+
+	if tagged == nil {
+		return index
+	}
+
+	for _, sf := range tagged.ForRead {
+		index[sf.Alias] = sf.Index
+	}
+
+	for _, rf := range sfs.relations {
+		if seen[rf.Related.structType] {
+			continue
+		}
+
+		seen[rf.Related.structType] = true
+
+		for alias, relIndex := range rf.Related.columnIndexSeen(seen) {
+			full := make([]int, 0, len(rf.Index)+len(relIndex))
+			full = append(full, rf.Index...)
+			full = append(full, relIndex...)
+			index[rf.Prefix+alias] = full
+		}
+
+		delete(seen, rf.Related.structType)
+	}
+
+	return index
+}
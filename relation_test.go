@@ -0,0 +1,101 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+// relationCategory is the self-referencing adjacency-list shape called out
+// by the request itself.
+type relationCategory struct {
+	ID       int
+	ParentID int
+	Parent   *relationCategory `relation:"category.parent_id=category.id"`
+}
+
+func TestColumnsForTagGuardsSelfReferencingRelation(t *testing.T) {
+	s := NewStruct(relationCategory{})
+
+	cols := s.ColumnsForTag("")
+	want := []string{"ID", "ParentID"}
+
+	if !reflect.DeepEqual(cols, want) {
+		t.Fatalf("ColumnsForTag() = %v, want %v (self-relation must not be expanded once its own type is already on the chain)", cols, want)
+	}
+}
+
+func TestAddrForTagGuardsSelfReferencingRelation(t *testing.T) {
+	s := NewStruct(relationCategory{})
+
+	addrs := s.AddrForTag("", &relationCategory{})
+
+	if len(addrs) != 2 {
+		t.Fatalf("AddrForTag() returned %d addresses, want 2", len(addrs))
+	}
+}
+
+// relationA and relationB form a mutual two-struct relation cycle: A joins
+// to B, and B joins back to A.
+type relationA struct {
+	ID int
+	B  *relationB `relation:"a.b_id=b.id"`
+}
+
+type relationB struct {
+	ID int
+	A  *relationA `relation:"b.a_id=a.id"`
+}
+
+func TestColumnsForTagGuardsMutualRelationCycle(t *testing.T) {
+	s := NewStruct(relationA{})
+
+	cols := s.ColumnsForTag("")
+	want := []string{"ID", "b__ID"}
+
+	if !reflect.DeepEqual(cols, want) {
+		t.Fatalf("ColumnsForTag() = %v, want %v (B's relation back to A must stop once A is already on the chain)", cols, want)
+	}
+}
+
+type scanOrderUser struct {
+	ID int64 `db:"id"`
+}
+
+type scanOrder struct {
+	ID   int64          `db:"id"`
+	User *scanOrderUser `relation:"order.user_id=user.id,type=left"`
+}
+
+// TestScanRowIntoPointerRelationField reproduces the request's own
+// type=left optional-relation case: scanning into a pointer-typed relation
+// field must allocate it on demand instead of panicking on the nil
+// intermediate pointer. fakeQueryRows is defined in scan_test.go.
+func TestScanRowIntoPointerRelationField(t *testing.T) {
+	s := NewStruct(scanOrder{})
+
+	rows := fakeQueryRows(t, []string{"id", "user__id"}, [][]driver.Value{
+		{int64(1), int64(42)},
+	})
+
+	order, err := ScanRow[scanOrder](s, rows)
+
+	if err != nil {
+		t.Fatalf("ScanRow returned error: %v", err)
+	}
+
+	if order.ID != 1 {
+		t.Fatalf("ID = %d, want 1", order.ID)
+	}
+
+	if order.User == nil {
+		t.Fatalf("User = nil, want an allocated relation struct")
+	}
+
+	if order.User.ID != 42 {
+		t.Fatalf("User.ID = %d, want 42", order.User.ID)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// scanPlan describes how to scan one row of driver columns into a struct
+// value, once the columns have been matched against the struct's fields.
+type scanPlan struct {
+	// fieldIndex[i] is the struct field index chain to scan the i-th driver
+	// column into, or nil if the column has no matching field and should be
+	// discarded.
+	fieldIndex [][]int
+}
+
+// columnsSignature builds a cheap, order-sensitive signature for cols so it
+// can be used as a cache key.
+func columnsSignature(cols []string) string {
+	return strings.Join(cols, "\x00")
+}
+
+// buildScanPlan matches cols against the fields of s tagged with s.structTag
+// and returns a plan to scan each column into its matching field, caching
+// the result in s.scanPlanCache for later reuse. The cache lives on s
+// itself rather than a package-level map: s.For/WithTag/WithFieldMapper/
+// WithConverters each hand back a new *Struct with its own fresh cache, so
+// a *Struct built per-request and then discarded doesn't pin its plans in
+// memory for the life of the process.
+func (s *Struct) buildScanPlan(cols []string) (*scanPlan, error) {
+	sig := columnsSignature(cols)
+
+	if cached, ok := s.scanPlanCache.Load(sig); ok {
+		return cached.(*scanPlan), nil
+	}
+
+	sfs := s.structFieldsParser()
+
+	if sfs.Tag(s.structTag) == nil {
+		return nil, fmt.Errorf("sqlbuilder: tag %q is not defined in %v", s.structTag, s.structType)
+	}
+
+	byAlias := s.columnIndex()
+
+	plan := &scanPlan{
+		fieldIndex: make([][]int, len(cols)),
+	}
+
+	for i, col := range cols {
+		if index, ok := byAlias[col]; ok {
+			plan.fieldIndex[i] = index
+		}
+	}
+
+	s.scanPlanCache.Store(sig, plan)
+	return plan, nil
+}
+
+// ScanRow advances rows by calling Next and scans the row it moves to into
+// a new T, using s's struct metadata to match driver columns against T's
+// db-tagged fields. If there is no next row, it returns sql.ErrNoRows (or
+// the error reported by rows.Err).
+//
+// Columns with no matching field in T are scanned into a throwaway sink, so
+// the caller doesn't need to hand-match the SELECT list against T.
+func ScanRow[T any](s *Struct, rows *sql.Rows) (T, error) {
+	var result T
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+
+		return result, sql.ErrNoRows
+	}
+
+	if err := s.scanInto(rows, &result); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ScanRows scans all remaining rows of rows into a []T using s's struct
+// metadata to match driver columns against T's db-tagged fields.
+func ScanRows[T any](s *Struct, rows *sql.Rows) ([]T, error) {
+	var result []T
+
+	for rows.Next() {
+		var item T
+
+		if err := s.scanInto(rows, &item); err != nil {
+			return nil, err
+		}
+
+		result = append(result, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// scanInto scans the current row of rows into dst, which must be a pointer
+// to a struct or a pointer to a pointer to a struct.
+func (s *Struct) scanInto(rows *sql.Rows, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	if v.Type() != s.structType {
+		return fmt.Errorf("sqlbuilder: type %v does not match struct type %v", v.Type(), s.structType)
+	}
+
+	cols, err := rows.Columns()
+
+	if err != nil {
+		return err
+	}
+
+	plan, err := s.buildScanPlan(cols)
+
+	if err != nil {
+		return err
+	}
+
+	addrs := make([]interface{}, len(cols))
+	var pending []pendingConversion
+	hasConverters := len(s.converters) > 0
+
+	for i, index := range plan.fieldIndex {
+		if index == nil {
+			addrs[i] = &sql.RawBytes{}
+			continue
+		}
+
+		field := fieldByIndexAlloc(v, index)
+
+		if hasConverters {
+			if s.hasConverterForDst(field.Type()) {
+				holder := new(interface{})
+				addrs[i] = holder
+				pending = append(pending, pendingConversion{field: field, holder: holder})
+				continue
+			}
+		}
+
+		addrs[i] = field.Addr().Interface()
+	}
+
+	if err := rows.Scan(addrs...); err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		converted, err := s.convertForRead(*p.holder, p.field.Type())
+
+		if err != nil {
+			return err
+		}
+
+		p.field.Set(reflect.ValueOf(converted))
+	}
+
+	return nil
+}
+
+// pendingConversion tracks a struct field whose scanned value still needs to
+// be run through a read-side TypeConverter before it's assigned.
+type pendingConversion struct {
+	field  reflect.Value
+	holder *interface{}
+}
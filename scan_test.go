@@ -0,0 +1,186 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+)
+
+// The fake driver below exists only so tests in this file can obtain a real
+// *sql.Rows (ScanRow/ScanRows take the concrete database/sql type, not an
+// interface) without a real database connection.
+
+var fakeDriverOnce sync.Once
+
+var fakeDriverMu sync.Mutex
+var fakeDriverCols []string
+var fakeDriverData [][]driver.Value
+
+func registerFakeDriver() {
+	fakeDriverOnce.Do(func() {
+		sql.Register("sqlbuilder-fake", fakeDriver{})
+	})
+}
+
+// fakeQueryRows opens a throwaway connection through the fake driver and
+// returns a *sql.Rows yielding cols/data, ignoring the query text.
+func fakeQueryRows(t *testing.T, cols []string, data [][]driver.Value) *sql.Rows {
+	t.Helper()
+	registerFakeDriver()
+
+	fakeDriverMu.Lock()
+	fakeDriverCols = cols
+	fakeDriverData = data
+	fakeDriverMu.Unlock()
+
+	db, err := sql.Open("sqlbuilder-fake", "")
+
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	rows, err := db.Query("SELECT fixture")
+
+	if err != nil {
+		t.Fatalf("db.Query: %v", err)
+	}
+
+	t.Cleanup(func() { rows.Close() })
+	return rows
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errNotSupported
+}
+
+func (fakeConn) Close() error { return nil }
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errNotSupported
+}
+
+func (fakeConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	fakeDriverMu.Lock()
+	defer fakeDriverMu.Unlock()
+
+	return &fakeRows{cols: fakeDriverCols, data: fakeDriverData}, nil
+}
+
+var errNotSupported = &fakeDriverError{"sqlbuilder-fake: not supported"}
+
+type fakeDriverError struct{ msg string }
+
+func (e *fakeDriverError) Error() string { return e.msg }
+
+type fakeRows struct {
+	cols []string
+	data [][]driver.Value
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.data) {
+		return io.EOF
+	}
+
+	copy(dest, r.data[r.pos])
+	r.pos++
+	return nil
+}
+
+type scanCacheRow struct {
+	A string
+	B string
+}
+
+// scanCacheSwapMapper maps each field to the other's default column name, so
+// two Structs built for the same Go type but different field mappers
+// disagree about which field a given column belongs to.
+func scanCacheSwapMapper(field string) string {
+	switch field {
+	case "A":
+		return "B"
+	case "B":
+		return "A"
+	default:
+		return field
+	}
+}
+
+// TestBuildScanPlanCacheIsScopedPerStruct guards the leak this request's
+// review comment reported: scanPlanCache must live on the *Struct that
+// built it, not a shared package-level map, so a Struct discarded after a
+// single WithFieldMapper/WithConverters call doesn't pin its plan in memory
+// forever, and so its plan can never be handed back to a sibling Struct
+// that resolves columns differently.
+func TestBuildScanPlanCacheIsScopedPerStruct(t *testing.T) {
+	s1 := NewStruct(scanCacheRow{})
+	s2 := s1.WithFieldMapper(scanCacheSwapMapper)
+
+	if s1.scanPlanCache == s2.scanPlanCache {
+		t.Fatalf("WithFieldMapper must give the returned Struct its own scan plan cache")
+	}
+
+	cols := []string{"A", "B"}
+
+	if _, err := s1.buildScanPlan(cols); err != nil {
+		t.Fatalf("s1.buildScanPlan: %v", err)
+	}
+
+	if _, ok := s2.scanPlanCache.Load(columnsSignature(cols)); ok {
+		t.Fatalf("s1's cached plan leaked into s2's cache")
+	}
+}
+
+// TestScanRowUsesEachStructsOwnFieldMapping is an end-to-end companion to
+// the cache-scoping test above: scanning the exact same columns through two
+// differently-mapped Structs for the same type must populate each one
+// according to its own mapping, not whichever built its plan first.
+func TestScanRowUsesEachStructsOwnFieldMapping(t *testing.T) {
+	s1 := NewStruct(scanCacheRow{})
+	s2 := s1.WithFieldMapper(scanCacheSwapMapper)
+	cols := []string{"A", "B"}
+
+	rows1 := fakeQueryRows(t, cols, [][]driver.Value{{"a-val", "b-val"}})
+	got1, err := ScanRow[scanCacheRow](s1, rows1)
+
+	if err != nil {
+		t.Fatalf("ScanRow(s1) returned error: %v", err)
+	}
+
+	if got1.A != "a-val" || got1.B != "b-val" {
+		t.Fatalf("ScanRow(s1) = %+v, want {A:a-val B:b-val}", got1)
+	}
+
+	rows2 := fakeQueryRows(t, cols, [][]driver.Value{{"a-val", "b-val"}})
+	got2, err := ScanRow[scanCacheRow](s2, rows2)
+
+	if err != nil {
+		t.Fatalf("ScanRow(s2) returned error: %v", err)
+	}
+
+	// s2 maps field A's column to "B" and field B's column to "A", so the
+	// same row is read back swapped relative to s1.
+	if got2.A != "b-val" || got2.B != "a-val" {
+		t.Fatalf("ScanRow(s2) = %+v, want {A:b-val B:a-val}", got2)
+	}
+}
@@ -5,9 +5,11 @@ package sqlbuilder
 
 import (
 	"bytes"
+	"fmt"
 	"math"
 	"reflect"
 	"regexp"
+	"sync"
 )
 
 var (
@@ -46,6 +48,17 @@ type Struct struct {
 	structType         reflect.Type
 	structFieldsParser structFieldsParser
 	structTag          string
+	converters         map[converterKey]TypeConverter
+	convertersBySrc    map[reflect.Type]TypeConverter
+
+	// scanPlanCache caches scanPlan by columns-signature for this Struct
+	// alone (see buildScanPlan in scan.go). It's a *sync.Map, not a plain
+	// map, so concurrent scans against the same Struct are safe without an
+	// extra lock, and it's reset to a fresh, empty map by every shadow-copy
+	// method below so a discarded *Struct (e.g. built per-request via
+	// WithFieldMapper/WithConverters) is freed together with its cached
+	// plans instead of living for the process lifetime in a global cache.
+	scanPlanCache *sync.Map
 }
 
 var emptyStruct Struct
@@ -61,11 +74,17 @@ func NewStruct(structValue interface{}) *Struct {
 		return &emptyStruct
 	}
 
-	return &Struct{
+	s := &Struct{
 		Flavor:             DefaultFlavor,
 		structType:         t,
 		structFieldsParser: makeDefaultFieldsParser(t),
+		scanPlanCache:      &sync.Map{},
 	}
+
+	// Register s so that a `relation`-tagged field elsewhere pointing at t
+	// resolves to this Struct instead of building a default one.
+	structRegistry.Store(t, s)
+	return s
 }
 
 // For sets the default flavor of s and returns a shadow copy of s.
@@ -73,6 +92,7 @@ func NewStruct(structValue interface{}) *Struct {
 func (s *Struct) For(flavor Flavor) *Struct {
 	c := *s
 	c.Flavor = flavor
+	c.scanPlanCache = &sync.Map{}
 	return &c
 }
 
@@ -85,6 +105,7 @@ func (s *Struct) WithFieldMapper(mapper FieldMapperFunc) *Struct {
 
 	c := *s
 	c.structFieldsParser = makeCustomFieldsParser(s.structType, mapper)
+	c.scanPlanCache = &sync.Map{}
 	return &c
 }
 
@@ -93,6 +114,7 @@ func (s *Struct) WithFieldMapper(mapper FieldMapperFunc) *Struct {
 func (s *Struct) WithTag(tag string) *Struct {
 	c := *s
 	c.structTag = tag
+	c.scanPlanCache = &sync.Map{}
 	return &c
 }
 
@@ -132,6 +154,25 @@ func (s *Struct) SelectFromForTag(table string, tag string) (sb *SelectBuilder)
 		buf.Reset()
 	}
 
+	seen := map[reflect.Type]bool{s.structType: true}
+
+	for _, rf := range sfs.relations {
+		if seen[rf.Related.structType] {
+			continue
+		}
+
+		seen[rf.Related.structType] = true
+
+		onExpr := fmt.Sprintf("%s.%s = %s.%s", table, rf.LocalCol, rf.Table, rf.RelCol)
+		sb.JoinWithOption(rf.JoinType, rf.Table, onExpr)
+
+		for _, col := range rf.Related.columnsForTagSeen(rf.Related.structTag, seen) {
+			cols = append(cols, fmt.Sprintf("%s.%s AS %s%s", rf.Table, col, rf.Prefix, col))
+		}
+
+		delete(seen, rf.Related.structType)
+	}
+
 	sb.Select(cols...)
 	return sb
 }
@@ -171,8 +212,7 @@ func (s *Struct) UpdateForTag(table string, tag string, value interface{}) *Upda
 	assignments := make([]string, 0, len(tagged.ForWrite))
 
 	for _, sf := range tagged.ForWrite {
-		name := sf.Name
-		val := v.FieldByName(name)
+		val := v.FieldByIndex(sf.Index)
 
 		if isEmptyValue(val) {
 			if sf.ShouldOmitEmpty("", tag) {
@@ -182,7 +222,12 @@ func (s *Struct) UpdateForTag(table string, tag string, value interface{}) *Upda
 			val = dereferencedValue(val)
 		}
 
-		data := val.Interface()
+		data, err := s.convertForWrite(val)
+
+		if err != nil {
+			continue
+		}
+
 		assignments = append(assignments, ub.Assign(sf.Quote(s.Flavor), data))
 	}
 
@@ -254,12 +299,11 @@ func (s *Struct) buildColsAndValuesForTag(ib *InsertBuilder, tag string, value .
 
 	for _, sf := range tagged.ForWrite {
 		cols = append(cols, sf.Quote(s.Flavor))
-		name := sf.Name
 		shouldOmitEmpty := sf.ShouldOmitEmpty("", tag)
 		nilCnt := 0
 
 		for i, v := range vs {
-			val := v.FieldByName(name)
+			val := v.FieldByIndex(sf.Index)
 
 			if isEmptyValue(val) && shouldOmitEmpty {
 				nilCnt++
@@ -268,7 +312,13 @@ func (s *Struct) buildColsAndValuesForTag(ib *InsertBuilder, tag string, value .
 			val = dereferencedValue(val)
 
 			if val.IsValid() {
-				values[i] = append(values[i], val.Interface())
+				data, err := s.convertForWrite(val)
+
+				if err != nil {
+					data = nil
+				}
+
+				values[i] = append(values[i], data)
 			} else {
 				values[i] = append(values[i], nil)
 			}
@@ -366,6 +416,13 @@ func (s *Struct) Addr(st interface{}) []interface{} {
 //
 // If tag is not defined in s in advance, returns nil.
 func (s *Struct) AddrForTag(tag string, st interface{}) []interface{} {
+	return s.addrForTagSeen(tag, st, map[reflect.Type]bool{s.structType: true})
+}
+
+// addrForTagSeen is AddrForTag with the set of struct types already on the
+// current relation chain, so a relation cycle (self-referencing or mutual)
+// stops recursing instead of overflowing the stack.
+func (s *Struct) addrForTagSeen(tag string, st interface{}, seen map[reflect.Type]bool) []interface{} {
 	sfs := s.structFieldsParser()
 	tagged := sfs.Tag(tag)
 
@@ -373,7 +430,35 @@ func (s *Struct) AddrForTag(tag string, st interface{}) []interface{} {
 		return nil
 	}
 
-	return s.addrWithFields(tagged.ForRead, st)
+	addrs := s.addrWithFields(tagged.ForRead, st)
+
+	if addrs == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(st)
+	v = dereferencedValue(v)
+
+	for _, rf := range sfs.relations {
+		if seen[rf.Related.structType] {
+			continue
+		}
+
+		seen[rf.Related.structType] = true
+
+		rel := fieldByIndexAlloc(v, rf.Index)
+
+		if rel.Kind() == reflect.Ptr && rel.IsNil() {
+			rel.Set(reflect.New(rel.Type().Elem()))
+		}
+
+		relSt := rel.Addr().Interface()
+		addrs = append(addrs, rf.Related.addrForTagSeen(rf.Related.structTag, relSt, seen)...)
+
+		delete(seen, rf.Related.structType)
+	}
+
+	return addrs
 }
 
 // AddrWithCols takes address of all columns defined in cols from the st.
@@ -406,8 +491,7 @@ func (s *Struct) addrWithFields(fields []*structField, st interface{}) []interfa
 	addrs := make([]interface{}, 0, len(fields))
 
 	for _, sf := range fields {
-		name := sf.Name
-		data := v.FieldByName(name).Addr().Interface()
+		data := fieldByIndexAlloc(v, sf.Index).Addr().Interface()
 		addrs = append(addrs, data)
 	}
 
@@ -419,8 +503,17 @@ func (s *Struct) Columns() []string {
 	return s.ColumnsForTag(s.structTag)
 }
 
-// ColumnsForTag returns column names of the s tagged with tag.
+// ColumnsForTag returns column names of the s tagged with tag. Columns of
+// any `relation`-tagged field are included too, prefixed with the relation's
+// alias (see Struct#SelectFromForTag).
 func (s *Struct) ColumnsForTag(tag string) (cols []string) {
+	return s.columnsForTagSeen(tag, map[reflect.Type]bool{s.structType: true})
+}
+
+// columnsForTagSeen is ColumnsForTag with the set of struct types already on
+// the current relation chain, so a relation cycle (self-referencing or
+// mutual) stops recursing instead of overflowing the stack.
+func (s *Struct) columnsForTagSeen(tag string, seen map[reflect.Type]bool) (cols []string) {
 	sfs := s.structFieldsParser()
 	tagged := sfs.Tag(tag)
 
@@ -434,6 +527,20 @@ func (s *Struct) ColumnsForTag(tag string) (cols []string) {
 		cols = append(cols, sf.Alias)
 	}
 
+	for _, rf := range sfs.relations {
+		if seen[rf.Related.structType] {
+			continue
+		}
+
+		seen[rf.Related.structType] = true
+
+		for _, col := range rf.Related.columnsForTagSeen(rf.Related.structTag, seen) {
+			cols = append(cols, rf.Prefix+col)
+		}
+
+		delete(seen, rf.Related.structType)
+	}
+
 	return
 }
 
@@ -461,8 +568,12 @@ func (s *Struct) ValuesForTag(tag string, value interface{}) (values []interface
 	values = make([]interface{}, 0, len(tagged.ForWrite))
 
 	for _, sf := range tagged.ForWrite {
-		name := sf.Name
-		data := v.FieldByName(name).Interface()
+		data, err := s.convertForWrite(v.FieldByIndex(sf.Index))
+
+		if err != nil {
+			continue
+		}
+
 		values = append(values, data)
 	}
 
@@ -485,6 +596,29 @@ func dereferencedValue(v reflect.Value) reflect.Value {
 	return v
 }
 
+// fieldByIndexAlloc walks v by index the same way reflect.Value#FieldByIndex
+// does, except that it allocates any nil pointer it encounters along the way
+// instead of panicking. v must be an addressable struct. This is needed to
+// reach into an optional (pointer-typed) `relation` field that hasn't been
+// populated yet, e.g. when building Scan destinations.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+
+				v = v.Elem()
+			}
+		}
+
+		v = v.Field(x)
+	}
+
+	return v
+}
+
 // isEmptyValue checks if v is zero.
 // Following code is borrowed from `IsZero` method in `reflect.Value` since Go 1.13.
 func isEmptyValue(v reflect.Value) bool {
@@ -0,0 +1,394 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// FieldMapperFunc is the function type to map a field name to a column name.
+// It's used by `Struct#WithFieldMapper` to customize the default field name to column name mapping.
+type FieldMapperFunc func(field string) string
+
+// structField holds the metadata parsed out of a single struct field's tags.
+type structField struct {
+	// Index is the index chain used to reach this field from the struct root,
+	// suitable for use with reflect.Value#FieldByIndex.
+	Index []int
+
+	// Name is the Go field name.
+	Name string
+
+	// Alias is the column name (or alias) used in SQL statements.
+	Alias string
+
+	// Op is the comparison operator to use when building a WHERE condition
+	// for this field via Struct#Where, e.g. "exact" or "gte".
+	Op string
+
+	quote     bool
+	omitEmpty map[string]bool
+	tags      map[string]bool
+}
+
+// Quote returns the field's column name quoted per flavor if the
+// "withquote" field option was set, or the bare alias otherwise.
+func (sf *structField) Quote(flavor Flavor) string {
+	if sf.quote {
+		return flavor.Quote(sf.Alias)
+	}
+
+	return sf.Alias
+}
+
+// NameForSelect returns the column expression to use in a SELECT field list.
+func (sf *structField) NameForSelect(flavor Flavor) string {
+	return sf.Quote(flavor)
+}
+
+// ShouldOmitEmpty reports whether an empty value for this field should be
+// skipped for tag. defaultTag is used when tag is the empty string.
+func (sf *structField) ShouldOmitEmpty(defaultTag, tag string) bool {
+	if tag == "" {
+		tag = defaultTag
+	}
+
+	return sf.omitEmpty[tag]
+}
+
+// taggedStructFields holds the subset of a struct's fields that are visible
+// for a particular `fieldtag` value.
+type taggedStructFields struct {
+	ForRead  []*structField
+	ForWrite []*structField
+}
+
+// Cols returns the structFields in fields matching cols, in the same order
+// as cols. It returns nil if any column in cols cannot be found.
+func (t *taggedStructFields) Cols(cols []string) []*structField {
+	if t == nil {
+		return nil
+	}
+
+	byAlias := make(map[string]*structField, len(t.ForRead))
+
+	for _, sf := range t.ForRead {
+		byAlias[sf.Alias] = sf
+	}
+
+	fields := make([]*structField, 0, len(cols))
+
+	for _, col := range cols {
+		sf, ok := byAlias[col]
+
+		if !ok {
+			return nil
+		}
+
+		fields = append(fields, sf)
+	}
+
+	return fields
+}
+
+// structFields is the parsed, tag-indexed view of a struct type's fields.
+type structFields struct {
+	all       []*structField
+	tags      map[string]*taggedStructFields
+	relations []*relationField
+}
+
+// Tag returns the tagged view of fields for tag, or nil if tag is unknown.
+func (sf *structFields) Tag(tag string) *taggedStructFields {
+	if sf == nil {
+		return nil
+	}
+
+	return sf.tags[tag]
+}
+
+// structFieldsParser lazily parses and caches a struct type's fields.
+// The returned *structFields is shared and must not be mutated.
+type structFieldsParser func() *structFields
+
+// makeDefaultFieldsParser creates a structFieldsParser using field names as-is.
+func makeDefaultFieldsParser(t reflect.Type) structFieldsParser {
+	return makeFieldsParser(t, nil)
+}
+
+// makeCustomFieldsParser creates a structFieldsParser using mapper to derive
+// the default column name of every field.
+func makeCustomFieldsParser(t reflect.Type, mapper FieldMapperFunc) structFieldsParser {
+	return makeFieldsParser(t, mapper)
+}
+
+func makeFieldsParser(t reflect.Type, mapper FieldMapperFunc) structFieldsParser {
+	var once sync.Once
+	var fields *structFields
+
+	return func() *structFields {
+		once.Do(func() {
+			fields = parseStructFields(t, mapper)
+		})
+
+		return fields
+	}
+}
+
+const fieldOptPrefix = "prefix"
+const fieldOptOp = "op"
+
+// opExact is the default comparison operator used by Struct#Where when a
+// field has no explicit operator.
+const opExact = "exact"
+
+// whereOps are the operator suffixes recognized on a `fieldopt:"op(...)"`
+// tag or a `Field__op` name suffix by Struct#Where.
+var whereOps = map[string]bool{
+	opExact:      true,
+	"ne":         true,
+	"gt":         true,
+	"gte":        true,
+	"lt":         true,
+	"lte":        true,
+	"in":         true,
+	"contains":   true,
+	"icontains":  true,
+	"startswith": true,
+	"endswith":   true,
+	"isnull":     true,
+	"between":    true,
+}
+
+// parseStructFields walks t's exported fields and groups them by fieldtag.
+// Anonymous struct fields are flattened into the parent's column set, and
+// named struct fields tagged with `fieldopt:"prefix(...)"` are recursed into
+// with their columns prefixed accordingly.
+func parseStructFields(t reflect.Type, mapper FieldMapperFunc) *structFields {
+	fields := &structFields{
+		tags: map[string]*taggedStructFields{
+			"": {},
+		},
+	}
+
+	walkStructFields(t, mapper, nil, "", map[reflect.Type]bool{t: true}, fields, false, nil)
+	return fields
+}
+
+// walkStructFields recurses into t's fields, accumulating the index chain
+// (parentIndex) and column prefix needed to reach each leaf field, and
+// records every leaf field found into fields. seen guards against cycles
+// created by embedding or nesting a struct type within itself.
+// inheritedQuote and inheritedOmitEmpty carry the "withquote"/"omitempty"
+// field options of any enclosing nested or embedded container field, so
+// they apply to its descendants too instead of being dropped at the
+// container.
+func walkStructFields(t reflect.Type, mapper FieldMapperFunc, parentIndex []int, prefix string, seen map[reflect.Type]bool, fields *structFields, inheritedQuote bool, inheritedOmitEmpty map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		index := make([]int, 0, len(parentIndex)+1)
+		index = append(index, parentIndex...)
+		index = append(index, f.Index[0])
+
+		if rf, ok := parseRelationTag(f); ok {
+			rf.Index = index
+			fields.relations = append(fields.relations, rf)
+			continue
+		}
+
+		ft := dereferencedType(f.Type)
+		opts := parseFieldOpts(f)
+
+		if (f.Anonymous || opts.nested) && ft.Kind() == reflect.Struct {
+			if seen[ft] {
+				continue
+			}
+
+			seen[ft] = true
+			walkStructFields(ft, mapper, index, prefix+opts.prefix, seen, fields, inheritedQuote || opts.quote, mergeOmitEmpty(inheritedOmitEmpty, opts.omitEmpty))
+			delete(seen, ft)
+			continue
+		}
+
+		sf := parseStructField(f, mapper, index, prefix, opts, inheritedQuote, inheritedOmitEmpty)
+
+		if sf == nil {
+			continue
+		}
+
+		fields.all = append(fields.all, sf)
+
+		for tag := range sf.tags {
+			tagged := fields.tags[tag]
+
+			if tagged == nil {
+				tagged = &taggedStructFields{}
+				fields.tags[tag] = tagged
+			}
+
+			tagged.ForRead = append(tagged.ForRead, sf)
+			tagged.ForWrite = append(tagged.ForWrite, sf)
+		}
+	}
+}
+
+// fieldOpts holds every `fieldopt` setting parsed off of a single struct
+// field, whether that field turns out to be a leaf column or a nested/
+// embedded container recursed into by walkStructFields.
+type fieldOpts struct {
+	quote     bool
+	omitEmpty map[string]bool
+	op        string
+	prefix    string
+	nested    bool
+}
+
+// parseFieldOpts parses every option in f's `fieldopt` tag, e.g.
+// `fieldopt:"prefix(billing_),omitempty,withquote"`. Unknown options are
+// ignored.
+func parseFieldOpts(f reflect.StructField) fieldOpts {
+	opts := fieldOpts{omitEmpty: map[string]bool{}}
+
+	optTag, ok := f.Tag.Lookup(FieldOpt)
+
+	if !ok {
+		return opts
+	}
+
+	for _, opt := range strings.Split(optTag, ",") {
+		opt = strings.TrimSpace(opt)
+
+		if opt == "" {
+			continue
+		}
+
+		m := optRegex.FindStringSubmatch(opt)
+
+		if m == nil {
+			continue
+		}
+
+		name := m[optRegex.SubexpIndex(optName)]
+		params := m[optRegex.SubexpIndex(optParams)]
+
+		switch name {
+		case fieldOptWithQuote:
+			opts.quote = true
+		case fieldOptOmitEmpty:
+			if params == "" {
+				opts.omitEmpty[""] = true
+			} else {
+				for _, tag := range strings.Split(params, ",") {
+					opts.omitEmpty[strings.TrimSpace(tag)] = true
+				}
+			}
+		case fieldOptOp:
+			if whereOps[params] {
+				opts.op = params
+			}
+		case fieldOptPrefix:
+			opts.prefix = params
+			opts.nested = true
+		}
+	}
+
+	return opts
+}
+
+// mergeOmitEmpty returns the union of parent and child, the set of tags a
+// nested field's own omitEmpty should be checked against after also
+// inheriting its container's. Either argument may be nil.
+func mergeOmitEmpty(parent, child map[string]bool) map[string]bool {
+	if len(parent) == 0 {
+		return child
+	}
+
+	merged := make(map[string]bool, len(parent)+len(child))
+
+	for tag := range parent {
+		merged[tag] = true
+	}
+
+	for tag := range child {
+		merged[tag] = true
+	}
+
+	return merged
+}
+
+// parseStructField parses a single leaf reflect.StructField into a
+// *structField. index is the full index chain from the struct root and
+// prefix is the column prefix inherited from any enclosing nested struct.
+// opts is f's own already-parsed fieldopt settings; inheritedQuote and
+// inheritedOmitEmpty are the withquote/omitempty options carried down from
+// any enclosing nested or embedded container field, and apply to f in
+// addition to its own. It returns nil if the field should be skipped
+// entirely (db:"-").
+func parseStructField(f reflect.StructField, mapper FieldMapperFunc, index []int, prefix string, opts fieldOpts, inheritedQuote bool, inheritedOmitEmpty map[string]bool) *structField {
+	name := f.Name
+	op := ""
+	baseName := name
+
+	if idx := strings.LastIndex(name, "__"); idx >= 0 && whereOps[name[idx+2:]] {
+		op = name[idx+2:]
+		baseName = name[:idx]
+	}
+
+	alias := baseName
+
+	if mapper != nil {
+		alias = mapper(baseName)
+	}
+
+	tags := map[string]bool{"": true}
+
+	if dbTag, ok := f.Tag.Lookup(DBTag); ok {
+		if dbTag == "-" {
+			return nil
+		}
+
+		if dbTag != "" {
+			alias = dbTag
+		}
+	}
+
+	alias = prefix + alias
+
+	if as, ok := f.Tag.Lookup(FieldAs); ok && as != "" {
+		alias = as
+	}
+
+	if fieldTag, ok := f.Tag.Lookup(FieldTag); ok {
+		for _, tag := range strings.Split(fieldTag, ",") {
+			tag = strings.TrimSpace(tag)
+
+			if tag != "" {
+				tags[tag] = true
+			}
+		}
+	}
+
+	if opts.op != "" {
+		op = opts.op
+	}
+
+	sf := &structField{
+		Index:     index,
+		Name:      name,
+		Alias:     alias,
+		Op:        op,
+		quote:     inheritedQuote || opts.quote,
+		omitEmpty: mergeOmitEmpty(inheritedOmitEmpty, opts.omitEmpty),
+		tags:      tags,
+	}
+
+	return sf
+}
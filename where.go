@@ -0,0 +1,151 @@
+// Copyright 2018 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package sqlbuilder
+
+import "reflect"
+
+// Where inspects value, a struct of s's type, and builds one Cond expression
+// per non-skipped field using cond. The result is meant to be passed
+// straight to `SelectBuilder#Where`, `UpdateBuilder#Where` or
+// `DeleteBuilder#Where`, e.g. sb.Where(s.Where(sb.Cond, filter)...).
+//
+// By default, a field is compared with the "exact" (=) operator. A field can
+// opt into a different operator either with a `fieldopt:"op(gte)"` tag or by
+// naming the field with an operator suffix, e.g. `CreatedAt__gte`. Supported
+// operators are exact, ne, gt, gte, lt, lte, in, contains, icontains,
+// startswith, endswith, isnull and between.
+//
+// A field whose value is the zero value for its type is skipped when the
+// field (or the tag) has `omitempty` set.
+func (s *Struct) Where(cond Cond, value interface{}) []string {
+	return s.WhereForTag(cond, s.structTag, value)
+}
+
+// WhereForTag is the tag-scoped version of Where.
+func (s *Struct) WhereForTag(cond Cond, tag string, value interface{}) []string {
+	sfs := s.structFieldsParser()
+	tagged := sfs.Tag(tag)
+
+	if tagged == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	v = dereferencedValue(v)
+
+	if v.Type() != s.structType {
+		return nil
+	}
+
+	exprs := make([]string, 0, len(tagged.ForWrite))
+
+	for _, sf := range tagged.ForWrite {
+		val := v.FieldByIndex(sf.Index)
+
+		if isEmptyValue(val) {
+			if sf.ShouldOmitEmpty("", tag) {
+				continue
+			}
+		} else {
+			val = dereferencedValue(val)
+		}
+
+		expr := whereExprForField(cond, s.Flavor, sf, val)
+
+		if expr != "" {
+			exprs = append(exprs, expr)
+		}
+	}
+
+	return exprs
+}
+
+// whereExprForField builds the Cond expression for a single field, based on
+// its operator. It returns "" if val can't be used with the field's
+// operator.
+func whereExprForField(cond Cond, flavor Flavor, sf *structField, val reflect.Value) string {
+	col := sf.Quote(flavor)
+	op := sf.Op
+
+	if op == "" {
+		op = opExact
+	}
+
+	switch op {
+	case "contains", "icontains", "startswith", "endswith":
+		if val.Kind() != reflect.String {
+			return ""
+		}
+	}
+
+	switch op {
+	case opExact:
+		return cond.Equal(col, val.Interface())
+	case "ne":
+		return cond.NotEqual(col, val.Interface())
+	case "gt":
+		return cond.GreaterThan(col, val.Interface())
+	case "gte":
+		return cond.GreaterEqualThan(col, val.Interface())
+	case "lt":
+		return cond.LessThan(col, val.Interface())
+	case "lte":
+		return cond.LessEqualThan(col, val.Interface())
+	case "in":
+		if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+			return ""
+		}
+
+		return cond.In(col, sliceValues(val)...)
+	case "contains":
+		return cond.Like(col, "%"+stringValue(val)+"%")
+	case "icontains":
+		return cond.ILike(col, "%"+stringValue(val)+"%")
+	case "startswith":
+		return cond.Like(col, stringValue(val)+"%")
+	case "endswith":
+		return cond.Like(col, "%"+stringValue(val))
+	case "isnull":
+		if val.Kind() == reflect.Bool && !val.Bool() {
+			return cond.IsNotNull(col)
+		}
+
+		return cond.IsNull(col)
+	case "between":
+		bounds := sliceValues(val)
+
+		if len(bounds) != 2 {
+			return ""
+		}
+
+		return cond.Between(col, bounds[0], bounds[1])
+	}
+
+	return ""
+}
+
+// sliceValues returns the elements of val, which must be a slice or array,
+// as a slice of interface{}.
+func sliceValues(val reflect.Value) []interface{} {
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return nil
+	}
+
+	values := make([]interface{}, val.Len())
+
+	for i := 0; i < val.Len(); i++ {
+		values[i] = val.Index(i).Interface()
+	}
+
+	return values
+}
+
+// stringValue returns val's underlying string, or "" if val is not a string.
+func stringValue(val reflect.Value) string {
+	if val.Kind() != reflect.String {
+		return ""
+	}
+
+	return val.String()
+}